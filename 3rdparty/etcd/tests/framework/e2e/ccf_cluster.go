@@ -0,0 +1,220 @@
+// Copyright 2022 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2e
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/pkg/v3/expect"
+	"go.etcd.io/etcd/tests/v3/framework/version"
+)
+
+const (
+	defaultPort = 8000
+	defaultHost = "127.0.0.1"
+)
+
+// ClusterVersion selects how many nodes of a cluster run the previous LSKV
+// release rather than the current build, so e2e tests can exercise rolling
+// upgrades between releases the way etcd's mixed-version e2e tests do.
+type ClusterVersion = version.ClusterVersion
+
+const (
+	AllCurrent          = version.AllCurrent
+	MinorityLastVersion = version.MinorityLastVersion
+	QuorumLastVersion   = version.QuorumLastVersion
+	MajorityLastVersion = version.MajorityLastVersion
+	AllLastVersion      = version.AllLastVersion
+)
+
+// ClusterConfig configures a CcfCluster.
+type ClusterConfig struct {
+	NodeCount int
+	Version   ClusterVersion
+}
+
+// build pins a node to a specific LSKV release.
+type build struct {
+	execPath    string
+	enclavePath string
+}
+
+// CcfCluster drives a group of LSKV sandbox processes for e2e tests, which
+// exercise full release binaries rather than talking to an in-process
+// harness.
+type CcfCluster struct {
+	t       testing.TB
+	members []*ccfMember
+}
+
+type ccfMember struct {
+	build build
+	host  string
+	port  int
+
+	proc   *expect.ExpectProcess
+	Client *clientv3.Client
+}
+
+// NewCcfCluster starts cfg.NodeCount sandbox processes, mixing in
+// previous-release binaries according to cfg.Version.
+func NewCcfCluster(t testing.TB, cfg ClusterConfig) *CcfCluster {
+	current := currentBuild(t)
+	usesLast := assignLastVersion(cfg.NodeCount, cfg.Version)
+
+	var previous *build
+	c := &CcfCluster{t: t}
+	for i := 0; i < cfg.NodeCount; i++ {
+		b := current
+		if usesLast[i] {
+			if previous == nil {
+				p := previousBuild(t)
+				previous = &p
+			}
+			b = *previous
+		}
+		m := &ccfMember{build: b, host: defaultHost, port: defaultPort + i}
+		m.start(t)
+		c.members = append(c.members, m)
+	}
+
+	for _, m := range c.members {
+		waitForCcfPort(m.endpoint())
+		client, err := m.newClient()
+		if err != nil {
+			t.Fatalf("failed to create client for %v: %v", m.endpoint(), err)
+		}
+		m.Client = client
+	}
+
+	return c
+}
+
+func currentBuild(t testing.TB) build {
+	sandbox := "/opt/ccf/bin/sandbox.sh"
+	if _, err := os.Stat(sandbox); err != nil {
+		t.Fatalf("failed to find sandbox: %v", err)
+	}
+	dir := os.Getenv("CCF_KVS_DIR")
+	if dir == "" {
+		t.Fatalf("failed to get CCF_KVS_DIR env variable")
+	}
+	enclave := fmt.Sprintf("%v/build/libccf_kvs.virtual.so", dir)
+	if _, err := os.Stat(enclave); err != nil {
+		t.Fatalf("failed to find enclave: %v", err)
+	}
+	return build{execPath: sandbox, enclavePath: enclave}
+}
+
+// previousBuild resolves the sandbox and enclave of the previous LSKV
+// release from CCF_KVS_DIR_PREVIOUS: bin/sandbox.sh and
+// build/libccf_kvs.virtual.so under that directory.
+func previousBuild(t testing.TB) build {
+	dir := os.Getenv("CCF_KVS_DIR_PREVIOUS")
+	if dir == "" {
+		t.Skip("CCF_KVS_DIR_PREVIOUS not set, skipping mixed-version test")
+	}
+	sandbox := fmt.Sprintf("%v/bin/sandbox.sh", dir)
+	if _, err := os.Stat(sandbox); err != nil {
+		t.Fatalf("failed to find previous-version sandbox: %v", err)
+	}
+	enclave := fmt.Sprintf("%v/build/libccf_kvs.virtual.so", dir)
+	if _, err := os.Stat(enclave); err != nil {
+		t.Fatalf("failed to find previous-version enclave: %v", err)
+	}
+	return build{execPath: sandbox, enclavePath: enclave}
+}
+
+// assignLastVersion returns, for each of nodeCount nodes, whether it should
+// run the previous release rather than the current build.
+func assignLastVersion(nodeCount int, v ClusterVersion) []bool {
+	return version.AssignLastVersion(nodeCount, v)
+}
+
+func (m *ccfMember) endpoint() string {
+	return net.JoinHostPort(m.host, strconv.Itoa(m.port))
+}
+
+func (m *ccfMember) start(t testing.TB) {
+	args := []string{
+		m.build.execPath,
+		"-p", m.build.enclavePath,
+		"--http2",
+		"--node-address", m.endpoint(),
+		"--rpc-interface", m.endpoint(),
+	}
+	proc, err := SpawnCmd(args, nil)
+	if err != nil {
+		t.Fatalf("failed to spawn sandbox: %v", err)
+	}
+	m.proc = proc
+}
+
+func (m *ccfMember) newClient() (*clientv3.Client, error) {
+	endpoint := fmt.Sprintf("https://%v", m.endpoint())
+	conf, err := clientv3.NewClientConfig(&clientv3.ConfigSpec{
+		Endpoints: []string{endpoint},
+		Secure: &clientv3.SecureConfig{
+			InsecureTransport:  true,
+			InsecureSkipVerify: true,
+		},
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return clientv3.New(*conf)
+}
+
+func waitForCcfPort(address string) {
+	timeout := time.Second
+	for {
+		conn, err := net.DialTimeout("tcp", address, timeout)
+		if err == nil {
+			conn.Close()
+			time.Sleep(time.Second)
+			return
+		}
+		time.Sleep(timeout)
+	}
+}
+
+func (c *CcfCluster) Close() error {
+	var lastErr error
+	for _, m := range c.members {
+		if m.Client != nil {
+			m.Client.Close()
+		}
+		if err := m.proc.Stop(); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// Members returns the cluster's client connections, in the same order the
+// nodes were started.
+func (c *CcfCluster) Members() []*clientv3.Client {
+	clients := make([]*clientv3.Client, len(c.members))
+	for i, m := range c.members {
+		clients[i] = m.Client
+	}
+	return clients
+}
@@ -2,10 +2,17 @@ package integration
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
+	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
 	"testing"
 	"time"
 
@@ -13,77 +20,271 @@ import (
 	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
+// ErrClusterIDMismatch is returned when two endpoints that are expected to
+// belong to the same CcfCluster report different service IDs -- the
+// signature of a stale sandbox from a previous run still listening on a
+// reused port, a common source of flaky tests when InsecureSkipVerify hides
+// the mismatch.
+var ErrClusterIDMismatch = errors.New("lskv: endpoints belong to different clusters (stale sandbox from a previous run?)")
+
 const (
-	defaultPort = "8000"
+	defaultPort = 8000
 	defaultHost = "127.0.0.1"
 )
 
+// CcfCluster manages a group of CCF sandbox nodes used by the KV/txn/lease/
+// watch integration tests.
 type CcfCluster struct {
-	cmd *exec.Cmd
-	t   testing.TB
-	ctx context.Context
+	t       testing.TB
+	ctx     context.Context
+	members []*CcfMember
+}
+
+// CcfMember is a single CCF sandbox node belonging to a CcfCluster.
+type CcfMember struct {
+	t testing.TB
+
+	sandbox string
+	enclave string
+
+	host string
+	port int
+
+	http2            bool
+	workerThreads    int
+	memberCount      int
+	snapshotInterval time.Duration
+	tlsConfig        *tls.Config
+
+	// dataDir is preserved across Stop/Restart so the node rejoins with
+	// its existing ledger.
+	dataDir string
+
+	cmd    *exec.Cmd
+	Client *clientv3.Client
+}
+
+// NewCcfCluster starts a CCF sandbox cluster configured by opts. With no
+// options it starts a single node on the current build, on defaultPort. See
+// WithNodes, WithHTTP2, WithHTTP1, WithEnclaveType, WithWorkerThreads,
+// WithLedgerDir, WithSnapshotInterval, WithMemberCount, WithTLSConfig and
+// WithSandboxBinary.
+func NewCcfCluster(t testing.TB, ctx context.Context, opts ...ClusterOption) *CcfCluster {
+	o := defaultClusterOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.ledgerDir != "" && o.nodeCount > 1 {
+		t.Fatalf("WithLedgerDir is only meaningful for single-node clusters, got %d nodes", o.nodeCount)
+	}
+
+	current := NodeConfig{ExecPath: o.sandboxBinary, EnclavePath: findEnclave(t, o.enclaveType)}
+	if current.ExecPath == "" {
+		current.ExecPath = findSandbox(t)
+	}
+	usesLast := assignLastVersion(o.nodeCount, o.version)
+
+	var previous *NodeConfig
+	c := &CcfCluster{t: t, ctx: ctx}
+	for i := 0; i < o.nodeCount; i++ {
+		node := current
+		if usesLast[i] {
+			if previous == nil {
+				p := previousVersionNode(t)
+				previous = &p
+			}
+			node = *previous
+		}
+
+		dataDir := o.ledgerDir
+		if dataDir == "" {
+			dataDir = t.TempDir()
+		}
+
+		m := &CcfMember{
+			t:                t,
+			sandbox:          node.ExecPath,
+			enclave:          node.EnclavePath,
+			host:             defaultHost,
+			port:             defaultPort + i,
+			http2:            o.http2,
+			workerThreads:    o.workerThreads,
+			snapshotInterval: o.snapshotInterval,
+			tlsConfig:        o.tlsConfig,
+			dataDir:          dataDir,
+		}
+		if i == 0 {
+			// --initial-member-count only applies to the founding node;
+			// the rest join the network it creates.
+			m.memberCount = o.memberCount
+		}
+		m.start()
+		c.members = append(c.members, m)
+	}
+
+	for _, m := range c.members {
+		waitForPort(m.Endpoint())
+		client, err := m.newClient()
+		if err != nil {
+			t.Fatalf("failed to create client for %v: %v", m.Endpoint(), err)
+		}
+		m.Client = client
+	}
+
+	if err := checkClusterIDs(c.members); err != nil {
+		t.Fatal(err)
+	}
+
+	return c
 }
 
-func NewCcfCluster(t testing.TB, ctx context.Context) *CcfCluster {
+func findSandbox(t testing.TB) string {
 	sandbox := "/opt/ccf/bin/sandbox.sh"
 	if _, err := os.Stat(sandbox); err != nil {
 		t.Fatalf("failed to find sandbox: %v", err)
 	}
+	return sandbox
+}
+
+func findEnclave(t testing.TB, enclaveType string) string {
 	ccfkvsdir_var := "CCF_KVS_DIR"
 	ccf_kvs_dir := os.Getenv(ccfkvsdir_var)
 	if ccf_kvs_dir == "" {
 		t.Fatalf("failed to get %v env variable", ccfkvsdir_var)
 	}
 
-	enclave := fmt.Sprintf("%v/build/libccf_kvs.virtual.so", ccf_kvs_dir)
+	enclave := fmt.Sprintf("%v/build/libccf_kvs.%v.so", ccf_kvs_dir, enclaveType)
 	if _, err := os.Stat(enclave); err != nil {
 		fmt.Printf("current dir: %v\n", os.Getenv("PWD"))
 		t.Fatalf("failed to find enclave: %v", err)
 	}
+	return enclave
+}
 
-	cmd := exec.Command(sandbox, "-p", enclave, "--http2")
+// start launches the sandbox process for this member, pointing it at its
+// own port and data directory.
+func (m *CcfMember) start() {
+	httpFlag := "--http2"
+	if !m.http2 {
+		httpFlag = "--http1"
+	}
+	args := []string{
+		"-p", m.enclave,
+		httpFlag,
+		"--node-address", net.JoinHostPort(m.host, strconv.Itoa(m.port)),
+		"--rpc-interface", net.JoinHostPort(m.host, strconv.Itoa(m.port)),
+		"--kvs-dir", m.dataDir,
+	}
+	if m.workerThreads > 0 {
+		args = append(args, "--worker-threads", strconv.Itoa(m.workerThreads))
+	}
+	if m.snapshotInterval > 0 {
+		args = append(args, "--snapshot-tx-interval", strconv.Itoa(int(m.snapshotInterval.Round(time.Second).Seconds())))
+	}
+	if m.memberCount > 0 {
+		args = append(args, "--initial-member-count", strconv.Itoa(m.memberCount))
+	}
+	cmd := exec.Command(m.sandbox, args...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	fmt.Printf("starting sandbox: %v\n", cmd)
 
-	err := cmd.Start()
-	if err != nil {
-		t.Fatalf("failed to start sandbox: %v", err)
+	if err := cmd.Start(); err != nil {
+		m.t.Fatalf("failed to start sandbox: %v", err)
+	}
+	m.cmd = cmd
+}
+
+// nodeState is the subset of CCF's GET /node/state response this harness
+// cares about.
+type nodeState struct {
+	NodeID             string `json:"node_id"`
+	State              string `json:"state"`
+	ServiceID          string `json:"service_id"`
+	LastCommittedSeqno int64  `json:"last_committed_seqno"`
+}
+
+func healthClient() *http.Client {
+	return &http.Client{
+		Timeout:   time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
 	}
+}
 
-	waitForPort(net.JoinHostPort(defaultHost, defaultPort))
-	return &CcfCluster{
-		cmd: cmd,
-		t:   t,
-		ctx: ctx,
+// fetchNodeState queries a member's /node/state endpoint.
+func fetchNodeState(address string) (*nodeState, error) {
+	resp, err := healthClient().Get(fmt.Sprintf("https://%v/node/state", address))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %v from %v/node/state", resp.Status, address)
 	}
+	var state nodeState
+	if err := json.NewDecoder(resp.Body).Decode(&state); err != nil {
+		return nil, err
+	}
+	return &state, nil
 }
 
-// wait for port to be up
+// waitForPort blocks until the node at address reports itself as
+// PartOfNetwork with a non-zero commit index. A bare TCP dial can return
+// before the node is actually ready to serve requests, which showed up as
+// flakes in tests that raced the sandbox's startup.
 func waitForPort(address string) {
-	timeout := time.Second
 	for {
-		conn, err := net.DialTimeout("tcp", address, timeout)
-		if err == nil {
-			fmt.Printf("port open (%v)\n", address)
-			conn.Close()
-			time.Sleep(time.Second)
+		state, err := fetchNodeState(address)
+		if err == nil && state.State == "PartOfNetwork" && state.LastCommittedSeqno > 0 {
+			fmt.Printf("node healthy (%v)\n", address)
 			return
 		}
-		time.Sleep(timeout)
-		fmt.Printf("waiting on port (%v)\n", address)
+		if err != nil {
+			fmt.Printf("waiting on node (%v): %v\n", address, err)
+		} else {
+			fmt.Printf("waiting on node (%v): state=%v seqno=%v\n", address, state.State, state.LastCommittedSeqno)
+		}
+		time.Sleep(time.Second)
 	}
 }
 
-func (c *CcfCluster) Members() []CcfMember {
-	// TODO
+// checkClusterIDs fetches each member's service ID and returns
+// ErrClusterIDMismatch if they disagree -- the signature of a stale
+// sandbox from a previous run still listening on a reused port.
+func checkClusterIDs(members []*CcfMember) error {
+	var want, wantEndpoint string
+	for _, m := range members {
+		state, err := fetchNodeState(m.Endpoint())
+		if err != nil {
+			return fmt.Errorf("failed to fetch node state for %v: %w", m.Endpoint(), err)
+		}
+		if want == "" {
+			want, wantEndpoint = state.ServiceID, m.Endpoint()
+			continue
+		}
+		if state.ServiceID != want {
+			return fmt.Errorf("%w: %v has service id %v, but %v has %v", ErrClusterIDMismatch, m.Endpoint(), state.ServiceID, wantEndpoint, want)
+		}
+	}
 	return nil
 }
 
-func (c *CcfCluster) Client() (*clientv3.Client, error) {
-	endpoints := fmt.Sprintf("https://%v", net.JoinHostPort(defaultHost, defaultPort))
+// Endpoint returns the host:port this member listens on.
+func (m *CcfMember) Endpoint() string {
+	return net.JoinHostPort(m.host, strconv.Itoa(m.port))
+}
+
+func (m *CcfMember) newClient() (*clientv3.Client, error) {
+	endpoint := fmt.Sprintf("https://%v", m.Endpoint())
+	if m.tlsConfig != nil {
+		return clientv3.New(clientv3.Config{
+			Endpoints: []string{endpoint},
+			TLS:       m.tlsConfig,
+		})
+	}
+
 	conf, err := clientv3.NewClientConfig(&clientv3.ConfigSpec{
-		Endpoints: []string{endpoints},
+		Endpoints: []string{endpoint},
 		Secure: &clientv3.SecureConfig{
 			InsecureTransport:  true,
 			InsecureSkipVerify: true,
@@ -92,41 +293,131 @@ func (c *CcfCluster) Client() (*clientv3.Client, error) {
 	if err != nil {
 		return nil, err
 	}
-	client, err := clientv3.New(*conf)
-	if err != nil {
-		return nil, err
+	return clientv3.New(*conf)
+}
+
+// Members returns the nodes in the cluster.
+func (c *CcfCluster) Members() []*CcfMember {
+	return c.members
+}
+
+// Client returns a client connected to the first member. Callers that care
+// which node they talk to (e.g. failover tests) should use WaitLeader and
+// Members() directly instead.
+func (c *CcfCluster) Client() (*clientv3.Client, error) {
+	if len(c.members) == 0 {
+		return nil, fmt.Errorf("cluster has no members")
 	}
-	return client, nil
+	return c.members[0].newClient()
 }
 
+// WaitLeader polls each member's status until one reports itself as primary,
+// and returns its index into Members(). It fails the test once c.ctx is
+// done, rather than blocking forever if no member ever becomes primary.
 func (c *CcfCluster) WaitLeader(t testing.TB) int {
-	// TODO
-	return 0
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		for i, m := range c.members {
+			if m.cmd == nil {
+				continue
+			}
+			if m.isPrimary() {
+				return i
+			}
+		}
+
+		select {
+		case <-c.ctx.Done():
+			t.Fatalf("timed out waiting for a leader: %v", c.ctx.Err())
+			return -1
+		case <-ticker.C:
+		}
+	}
 }
 
-func (c *CcfCluster) Close() error {
-	fmt.Println("killing sandbox")
-	err := c.cmd.Process.Kill()
+// isPrimary probes this member's status RPC and reports whether it currently
+// considers itself the primary (leader) of the network.
+func (m *CcfMember) isPrimary() bool {
+	client := m.Client
+	if client == nil {
+		var err error
+		client, err = m.newClient()
+		if err != nil {
+			return false
+		}
+		defer client.Close()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resp, err := client.Status(ctx, m.Endpoint())
 	if err != nil {
-		return err
+		return false
 	}
-	err = c.cmd.Wait()
-	return err
+	return resp.Leader == resp.Header.MemberId
 }
 
-type ccfClient struct{}
+func (c *CcfCluster) Close() error {
+	var lastErr error
+	for _, m := range c.members {
+		if m.cmd == nil {
+			continue
+		}
+		if err := m.close(); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
 
-type CcfMember struct {
-	Client *clientv3.Client
+func (m *CcfMember) close() error {
+	fmt.Printf("killing sandbox (%v)\n", m.Endpoint())
+	if m.Client != nil {
+		m.Client.Close()
+		m.Client = nil
+	}
+	if err := m.cmd.Process.Kill(); err != nil {
+		return err
+	}
+	return m.cmd.Wait()
 }
 
-// Restart starts the member using the preserved data dir.
-func (c *CcfMember) Restart(t testutil.TB) error {
-	// TODO
+// Restart starts the member again, reusing its preserved data dir so it
+// rejoins the network at its previous ledger position.
+func (m *CcfMember) Restart(t testutil.TB) error {
+	if m.cmd != nil {
+		return fmt.Errorf("member %v is already running", m.Endpoint())
+	}
+	m.start()
+	waitForPort(m.Endpoint())
+	client, err := m.newClient()
+	if err != nil {
+		return err
+	}
+	m.Client = client
 	return nil
 }
 
-// Stop stops the member, but the data dir of the member is preserved.
-func (c *CcfMember) Stop(t testutil.TB) {
-	// TODO
+// Stop stops the member by signalling its process, but preserves its data
+// dir on disk so a later Restart can rejoin the network.
+func (m *CcfMember) Stop(t testutil.TB) {
+	if m.cmd == nil {
+		return
+	}
+	if m.Client != nil {
+		m.Client.Close()
+		m.Client = nil
+	}
+	if err := m.cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		t.Fatalf("failed to stop member %v: %v", m.Endpoint(), err)
+	}
+	_ = m.cmd.Wait()
+	m.cmd = nil
+}
+
+// dataDirPath is exposed for tests that want to assert on ledger contents
+// after a Stop/Restart cycle.
+func (m *CcfMember) dataDirPath() string {
+	return filepath.Clean(m.dataDir)
 }
@@ -0,0 +1,81 @@
+package integration
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Failpoints is an HTTP client for a failpoints admin endpoint, letting
+// tests arm and disarm named fault-injection points (e.g. beforeCommit,
+// afterApply, snapshotSend) by name, mirroring the gofail workflow etcd
+// itself uses for deterministic fault-injection coverage.
+//
+// Scope: this package only ships the client. Compiling named injection
+// points into the KV/consensus paths under a FAILPOINTS=true build, and
+// serving /node/failpoints from the enclave, are C++ enclave-side work that
+// lives outside this Go test framework and has not landed -- there is no
+// enclave source in this tree to change. Until it does, LSKV has no actual
+// fault-injection coverage; this client exists so that work has something
+// to plug into, and is covered by failpoints_test.go against a fake HTTP
+// server rather than a real sandbox.
+type Failpoints struct {
+	endpoint string
+	client   *http.Client
+}
+
+// Failpoints returns a handle for arming fault injection on this member.
+func (m *CcfMember) Failpoints() *Failpoints {
+	return &Failpoints{
+		endpoint: fmt.Sprintf("https://%v/node/failpoints", m.Endpoint()),
+		client: &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			},
+		},
+	}
+}
+
+// Failpoints returns a handle for each member, keyed by its index in
+// Members().
+func (c *CcfCluster) Failpoints() map[int]*Failpoints {
+	fps := make(map[int]*Failpoints, len(c.members))
+	for i, m := range c.members {
+		fps[i] = m.Failpoints()
+	}
+	return fps
+}
+
+// Activate arms the named failpoint with a gofail-style term, e.g.
+// "panic", "sleep(100)", `return("err")` or "50%return".
+func (f *Failpoints) Activate(name, term string) error {
+	req, err := http.NewRequest(http.MethodPut, fmt.Sprintf("%v/%v", f.endpoint, name), bytes.NewBufferString(term))
+	if err != nil {
+		return err
+	}
+	return f.do(req, name, "activate")
+}
+
+// Deactivate disarms the named failpoint.
+func (f *Failpoints) Deactivate(name string) error {
+	req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf("%v/%v", f.endpoint, name), nil)
+	if err != nil {
+		return err
+	}
+	return f.do(req, name, "deactivate")
+}
+
+func (f *Failpoints) do(req *http.Request, name, verb string) error {
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to %v failpoint %v: %v: %s", verb, name, resp.Status, body)
+	}
+	return nil
+}
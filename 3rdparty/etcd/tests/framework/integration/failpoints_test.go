@@ -0,0 +1,74 @@
+package integration
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestFailpoints points a Failpoints client at a fake /node/failpoints
+// server, since there's no enclave-side handler in this tree to test
+// against.
+func newTestFailpoints(srv *httptest.Server) *Failpoints {
+	return &Failpoints{
+		endpoint: srv.URL + "/node/failpoints",
+		client:   srv.Client(),
+	}
+}
+
+func TestFailpointsActivate(t *testing.T) {
+	var gotMethod, gotPath, gotBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod = r.Method
+		gotPath = r.URL.Path
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	if err := newTestFailpoints(srv).Activate("beforeCommit", "panic"); err != nil {
+		t.Fatalf("activate failed: %v", err)
+	}
+	if gotMethod != http.MethodPut {
+		t.Errorf("got method %v, want PUT", gotMethod)
+	}
+	if gotPath != "/node/failpoints/beforeCommit" {
+		t.Errorf("got path %v, want /node/failpoints/beforeCommit", gotPath)
+	}
+	if gotBody != "panic" {
+		t.Errorf("got body %v, want panic", gotBody)
+	}
+}
+
+func TestFailpointsDeactivate(t *testing.T) {
+	var gotMethod, gotPath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod = r.Method
+		gotPath = r.URL.Path
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	if err := newTestFailpoints(srv).Deactivate("beforeCommit"); err != nil {
+		t.Fatalf("deactivate failed: %v", err)
+	}
+	if gotMethod != http.MethodDelete {
+		t.Errorf("got method %v, want DELETE", gotMethod)
+	}
+	if gotPath != "/node/failpoints/beforeCommit" {
+		t.Errorf("got path %v, want /node/failpoints/beforeCommit", gotPath)
+	}
+}
+
+func TestFailpointsActivateError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	if err := newTestFailpoints(srv).Activate("unknown", "panic"); err == nil {
+		t.Fatal("expected an error activating an unknown failpoint, got nil")
+	}
+}
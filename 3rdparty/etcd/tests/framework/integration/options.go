@@ -0,0 +1,105 @@
+package integration
+
+import (
+	"crypto/tls"
+	"time"
+)
+
+// clusterOptions holds the resolved configuration for a CcfCluster, built up
+// from a defaultClusterOptions() baseline by the ClusterOption functions
+// passed to NewCcfCluster.
+type clusterOptions struct {
+	nodeCount     int
+	memberCount   int
+	http2         bool
+	enclaveType   string
+	workerThreads int
+	ledgerDir     string
+
+	snapshotInterval time.Duration
+
+	tlsConfig     *tls.Config
+	sandboxBinary string
+
+	version ClusterVersion
+}
+
+func defaultClusterOptions() clusterOptions {
+	return clusterOptions{
+		nodeCount:   1,
+		memberCount: 1,
+		http2:       true,
+		enclaveType: "virtual",
+		version:     AllCurrent,
+	}
+}
+
+// ClusterOption configures a CcfCluster created by NewCcfCluster.
+type ClusterOption func(*clusterOptions)
+
+// WithNodes sets the number of sandbox nodes to start. Defaults to 1.
+func WithNodes(n int) ClusterOption {
+	return func(o *clusterOptions) { o.nodeCount = n }
+}
+
+// WithHTTP2 starts each node's frontend over HTTP/2. This is the default.
+func WithHTTP2() ClusterOption {
+	return func(o *clusterOptions) { o.http2 = true }
+}
+
+// WithHTTP1 starts each node's frontend over HTTP/1.1 instead of the
+// default HTTP/2.
+func WithHTTP1() ClusterOption {
+	return func(o *clusterOptions) { o.http2 = false }
+}
+
+// WithEnclaveType selects which enclave build to run: "virtual", "sgx" or
+// "snp". Defaults to "virtual".
+func WithEnclaveType(enclaveType string) ClusterOption {
+	return func(o *clusterOptions) { o.enclaveType = enclaveType }
+}
+
+// WithWorkerThreads sets the number of worker threads each node starts
+// with.
+func WithWorkerThreads(n int) ClusterOption {
+	return func(o *clusterOptions) { o.workerThreads = n }
+}
+
+// WithLedgerDir pins every node's data directory to path instead of a fresh
+// t.TempDir() per node. Only meaningful for single-node clusters, since
+// multiple nodes can't share a ledger directory.
+func WithLedgerDir(path string) ClusterOption {
+	return func(o *clusterOptions) { o.ledgerDir = path }
+}
+
+// WithSnapshotInterval sets how often nodes snapshot, rounded to the
+// nearest second.
+func WithSnapshotInterval(d time.Duration) ClusterOption {
+	return func(o *clusterOptions) { o.snapshotInterval = d }
+}
+
+// WithMemberCount sets the number of governance members to create.
+// Defaults to 1.
+func WithMemberCount(n int) ClusterOption {
+	return func(o *clusterOptions) { o.memberCount = n }
+}
+
+// WithTLSConfig makes Client() and Members()[i].Client dial with the given
+// TLS config instead of the default insecure, self-signed-friendly
+// transport -- required for tests that need real certificate verification.
+func WithTLSConfig(cfg *tls.Config) ClusterOption {
+	return func(o *clusterOptions) { o.tlsConfig = cfg }
+}
+
+// WithSandboxBinary overrides the sandbox.sh launcher to use, instead of
+// the current build's /opt/ccf/bin/sandbox.sh.
+func WithSandboxBinary(path string) ClusterOption {
+	return func(o *clusterOptions) { o.sandboxBinary = path }
+}
+
+// WithVersion controls the mixture of current vs. previous-release binaries
+// across the cluster's nodes, for rolling upgrade/downgrade tests. Defaults
+// to AllCurrent.
+func WithVersion(v ClusterVersion) ClusterOption {
+	return func(o *clusterOptions) { o.version = v }
+}
@@ -0,0 +1,34 @@
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestClusterOptionsSingleNode sanity-checks that a cluster built from
+// non-default ClusterOptions still comes up and serves requests, since the
+// option struct now has to flow through to both the sandbox command line
+// and the returned client.
+func TestClusterOptionsSingleNode(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	cluster := NewCcfCluster(t, ctx,
+		WithNodes(1),
+		WithHTTP1(),
+		WithEnclaveType("virtual"),
+		WithWorkerThreads(2),
+		WithSnapshotInterval(10*time.Second),
+		WithLedgerDir(t.TempDir()),
+	)
+	defer cluster.Close()
+
+	client, err := cluster.Client()
+	if err != nil {
+		t.Fatalf("failed to get client: %v", err)
+	}
+	if _, err := client.Put(ctx, "options-key", "options-value"); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestV3Failover writes a key through the current leader, kills it, waits
+// for the cluster to elect a new primary, and checks that the survivors
+// still observe the committed write -- exercising CCF's consensus
+// guarantees the way etcd's own failover tests exercise raft.
+func TestV3Failover(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	cluster := NewCcfCluster(t, ctx, WithNodes(3))
+	defer cluster.Close()
+
+	leader := cluster.WaitLeader(t)
+	members := cluster.Members()
+
+	key, value := []byte("failover-key"), []byte("failover-value")
+	if _, err := members[leader].Client.Put(ctx, string(key), string(value)); err != nil {
+		t.Fatalf("failed to put via leader: %v", err)
+	}
+
+	members[leader].Stop(t)
+
+	newLeader := cluster.WaitLeader(t)
+	if newLeader == leader {
+		t.Fatalf("expected a new leader after stopping member %d, got the same one", leader)
+	}
+
+	for i, m := range members {
+		if i == leader {
+			continue
+		}
+		resp, err := m.Client.Get(ctx, string(key))
+		if err != nil {
+			t.Fatalf("failed to get from member %d: %v", i, err)
+		}
+		if len(resp.Kvs) != 1 || string(resp.Kvs[0].Value) != string(value) {
+			t.Fatalf("member %d did not observe committed write: %+v", i, resp.Kvs)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestCcfMixedVersionClusterOption runs the standard put/get assertions
+// against a cluster built with WithVersion for every ClusterVersion, the
+// integration-package counterpart to the e2e package's
+// TestCcfMixedVersion. Subtests that need a previous-release node skip
+// (via previousVersionNode) when CCF_KVS_DIR_PREVIOUS isn't set.
+func TestCcfMixedVersionClusterOption(t *testing.T) {
+	versions := []ClusterVersion{
+		AllCurrent,
+		MinorityLastVersion,
+		QuorumLastVersion,
+		MajorityLastVersion,
+		AllLastVersion,
+	}
+
+	for _, v := range versions {
+		v := v
+		t.Run(clusterVersionName(v), func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+
+			cluster := NewCcfCluster(t, ctx, WithNodes(3), WithVersion(v))
+			defer cluster.Close()
+
+			client, err := cluster.Client()
+			if err != nil {
+				t.Fatalf("failed to get client: %v", err)
+			}
+			if _, err := client.Put(ctx, "mixed-version-key", "mixed-version-value"); err != nil {
+				t.Fatalf("put failed: %v", err)
+			}
+			resp, err := client.Get(ctx, "mixed-version-key")
+			if err != nil || len(resp.Kvs) != 1 {
+				t.Fatalf("get after put failed: resp=%+v err=%v", resp, err)
+			}
+		})
+	}
+}
+
+func clusterVersionName(v ClusterVersion) string {
+	switch v {
+	case AllCurrent:
+		return "AllCurrent"
+	case MinorityLastVersion:
+		return "MinorityLastVersion"
+	case QuorumLastVersion:
+		return "QuorumLastVersion"
+	case MajorityLastVersion:
+		return "MajorityLastVersion"
+	case AllLastVersion:
+		return "AllLastVersion"
+	default:
+		return "Unknown"
+	}
+}
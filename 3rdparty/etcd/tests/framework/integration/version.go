@@ -0,0 +1,69 @@
+package integration
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"go.etcd.io/etcd/tests/v3/framework/version"
+)
+
+// ClusterVersion selects how many nodes of a cluster run the previous LSKV
+// release rather than the current build, so tests can exercise rolling
+// upgrades and downgrades between releases.
+type ClusterVersion = version.ClusterVersion
+
+const (
+	// AllCurrent runs every node on the build under test.
+	AllCurrent = version.AllCurrent
+	// MinorityLastVersion runs fewer than a quorum of nodes on the
+	// previous release, so the current build always holds quorum.
+	MinorityLastVersion = version.MinorityLastVersion
+	// QuorumLastVersion runs exactly a quorum of nodes on the previous
+	// release, the smallest mix that can still make progress.
+	QuorumLastVersion = version.QuorumLastVersion
+	// MajorityLastVersion runs at least a quorum of nodes on the
+	// previous release.
+	MajorityLastVersion = version.MajorityLastVersion
+	// AllLastVersion runs every node on the previous release, useful as
+	// the starting point of an upgrade test.
+	AllLastVersion = version.AllLastVersion
+)
+
+// NodeConfig pins a single cluster member to a specific LSKV build,
+// allowing mixed-version clusters where nodes run different releases.
+type NodeConfig struct {
+	// ExecPath is the sandbox.sh launcher to use for this node. Empty
+	// means the current build's sandbox.
+	ExecPath string
+	// EnclavePath is the enclave shared object to use for this node.
+	// Empty means the current build's enclave.
+	EnclavePath string
+}
+
+// previousVersionNode resolves the sandbox and enclave paths of the
+// previous LSKV release, used by mixed-version tests to exercise rolling
+// upgrades. Both are looked up under CCF_KVS_DIR_PREVIOUS, as
+// bin/sandbox.sh and build/libccf_kvs.virtual.so.
+func previousVersionNode(t testing.TB) NodeConfig {
+	dir := os.Getenv("CCF_KVS_DIR_PREVIOUS")
+	if dir == "" {
+		t.Skip("CCF_KVS_DIR_PREVIOUS not set, skipping mixed-version test")
+	}
+
+	sandbox := fmt.Sprintf("%v/bin/sandbox.sh", dir)
+	if _, err := os.Stat(sandbox); err != nil {
+		t.Fatalf("failed to find previous-version sandbox: %v", err)
+	}
+	enclave := fmt.Sprintf("%v/build/libccf_kvs.virtual.so", dir)
+	if _, err := os.Stat(enclave); err != nil {
+		t.Fatalf("failed to find previous-version enclave: %v", err)
+	}
+	return NodeConfig{ExecPath: sandbox, EnclavePath: enclave}
+}
+
+// assignLastVersion returns, for each of nodeCount nodes, whether it should
+// run the previous release rather than the current build.
+func assignLastVersion(nodeCount int, v ClusterVersion) []bool {
+	return version.AssignLastVersion(nodeCount, v)
+}
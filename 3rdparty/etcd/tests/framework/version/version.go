@@ -0,0 +1,56 @@
+// Package version holds the mixed-version cluster config shared by the
+// integration and e2e frameworks, so the two don't maintain separate copies
+// of the same node-to-release assignment logic.
+package version
+
+// ClusterVersion selects how many nodes of a cluster run the previous LSKV
+// release rather than the current build, so tests can exercise rolling
+// upgrades and downgrades between releases.
+type ClusterVersion int
+
+const (
+	// AllCurrent runs every node on the build under test.
+	AllCurrent ClusterVersion = iota
+	// MinorityLastVersion runs fewer than a quorum of nodes on the
+	// previous release, so the current build always holds quorum.
+	MinorityLastVersion
+	// QuorumLastVersion runs exactly a bare quorum of nodes on the
+	// previous release, the smallest mix that can still make progress.
+	QuorumLastVersion
+	// MajorityLastVersion runs one node more on the previous release than
+	// QuorumLastVersion does, capped at every node, so on small clusters it
+	// can match QuorumLastVersion or AllLastVersion.
+	MajorityLastVersion
+	// AllLastVersion runs every node on the previous release, useful as
+	// the starting point of an upgrade test.
+	AllLastVersion
+)
+
+// AssignLastVersion returns, for each of nodeCount nodes, whether it should
+// run the previous release rather than the current build. The node counts
+// for each ClusterVersion are ordered Minority < Quorum <= Majority <= All.
+func AssignLastVersion(nodeCount int, v ClusterVersion) []bool {
+	usesLast := make([]bool, nodeCount)
+
+	var n int
+	switch v {
+	case AllCurrent:
+		return usesLast
+	case AllLastVersion:
+		n = nodeCount
+	case MinorityLastVersion:
+		n = (nodeCount - 1) / 2
+	case QuorumLastVersion:
+		n = nodeCount/2 + 1
+	case MajorityLastVersion:
+		n = nodeCount/2 + 2
+		if n > nodeCount {
+			n = nodeCount
+		}
+	}
+
+	for i := 0; i < n && i < nodeCount; i++ {
+		usesLast[i] = true
+	}
+	return usesLast
+}